@@ -0,0 +1,141 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cveschema5 models the subset of the CVE Record Format 5.x schema
+// (as served by CVE Services, https://github.com/CVEProject/cve-schema)
+// that nvdtools converters need in order to emit CVE JSON 5.0 records.
+package cveschema5
+
+// CVEState is the lifecycle state of a CVE ID, as tracked by cveMetadata.state.
+type CVEState string
+
+// Valid values of cveMetadata.state.
+const (
+	StatePublished CVEState = "PUBLISHED"
+	StateRejected  CVEState = "REJECTED"
+)
+
+// CVERecord is the top level container of a CVE Record Format 5.x document.
+type CVERecord struct {
+	DataType    string      `json:"dataType"`
+	DataVersion string      `json:"dataVersion"`
+	CVEMetadata CVEMetadata `json:"cveMetadata"`
+	Containers  Containers  `json:"containers"`
+}
+
+// NewCVERecord returns a CVERecord with dataType/dataVersion set to the
+// values required by the schema, ready to be filled in by a converter.
+func NewCVERecord(id string) *CVERecord {
+	return &CVERecord{
+		DataType:    "CVE_RECORD",
+		DataVersion: "5.0",
+		CVEMetadata: CVEMetadata{
+			CVEID: id,
+			State: StatePublished,
+		},
+	}
+}
+
+// CVEMetadata carries the identifiers and state of the record.
+type CVEMetadata struct {
+	CVEID             string   `json:"cveId"`
+	AssignerOrgID     string   `json:"assignerOrgId,omitempty"`
+	AssignerShortName string   `json:"assignerShortName,omitempty"`
+	State             CVEState `json:"state"`
+	DatePublished     string   `json:"datePublished,omitempty"`
+	DateUpdated       string   `json:"dateUpdated,omitempty"`
+}
+
+// Containers holds the CNA (and, once supported, ADP) containers of the record.
+type Containers struct {
+	CNA CNAContainer `json:"cna"`
+}
+
+// CNAContainer is the container populated by the CVE Numbering Authority,
+// i.e. the vendor converter in this repo's case.
+type CNAContainer struct {
+	ProviderMetadata ProviderMetadata `json:"providerMetadata"`
+	Title            string           `json:"title,omitempty"`
+	Descriptions     []Description    `json:"descriptions,omitempty"`
+	Affected         []Affected       `json:"affected,omitempty"`
+	Metrics          []Metric         `json:"metrics,omitempty"`
+	References       []Reference      `json:"references,omitempty"`
+	ProblemTypes     []ProblemType    `json:"problemTypes,omitempty"`
+}
+
+// ProviderMetadata identifies the org that authored a container.
+type ProviderMetadata struct {
+	OrgID       string `json:"orgId,omitempty"`
+	ShortName   string `json:"shortName,omitempty"`
+	DateUpdated string `json:"dateUpdated,omitempty"`
+}
+
+// Description is a human readable description of the vulnerability in a given language.
+type Description struct {
+	Lang  string `json:"lang"`
+	Value string `json:"value"`
+}
+
+// Affected describes a product/vendor pair and the version ranges impacted.
+type Affected struct {
+	Vendor   string    `json:"vendor,omitempty"`
+	Product  string    `json:"product,omitempty"`
+	Versions []Version `json:"versions,omitempty"`
+}
+
+// Version is a single entry in an Affected.Versions list.
+type Version struct {
+	Version     string `json:"version"`
+	Status      string `json:"status"`
+	LessThan    string `json:"lessThan,omitempty"`
+	VersionType string `json:"versionType,omitempty"`
+}
+
+// Metric wraps exactly one of the supported CVSS versions, mirroring the
+// schema's oneOf on cvssV3_1/cvssV4_0/format.
+type Metric struct {
+	Format   string    `json:"format,omitempty"`
+	CVSSV3_1 *CVSSData `json:"cvssV3_1,omitempty"`
+	CVSSV4_0 *CVSSData `json:"cvssV4_0,omitempty"`
+}
+
+// CVSSData is a generic holder for a CVSS vector/score pair; it deliberately
+// doesn't validate against the full CVSS JSON schema since converters only
+// need to round-trip vectorString and baseScore/baseSeverity.
+type CVSSData struct {
+	Version      string  `json:"version"`
+	VectorString string  `json:"vectorString"`
+	BaseScore    float64 `json:"baseScore"`
+	BaseSeverity string  `json:"baseSeverity,omitempty"`
+}
+
+// Reference is a single external reference URL, optionally tagged.
+type Reference struct {
+	URL  string   `json:"url"`
+	Name string   `json:"name,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+// ProblemType captures a single weakness (e.g. CWE) description.
+type ProblemType struct {
+	Descriptions []ProblemTypeDescription `json:"descriptions"`
+}
+
+// ProblemTypeDescription is one entry of a ProblemType, usually a CWE ID.
+type ProblemTypeDescription struct {
+	Lang        string `json:"lang"`
+	Description string `json:"description"`
+	CWEID       string `json:"cweId,omitempty"`
+	Type        string `json:"type,omitempty"`
+}
@@ -0,0 +1,136 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+// sinceFlag lets -since be given either as an RFC3339 timestamp or as a
+// number of seconds since the epoch, and always exposes the result as a
+// unix timestamp.
+type sinceFlag int64
+
+func (s *sinceFlag) String() string {
+	return fmt.Sprintf("%d", int64(*s))
+}
+
+func (s *sinceFlag) Set(value string) error {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		*s = sinceFlag(t.Unix())
+		return nil
+	}
+	var unix int64
+	if _, err := fmt.Sscanf(value, "%d", &unix); err != nil {
+		return fmt.Errorf("can't parse %q as RFC3339 timestamp or unix seconds", value)
+	}
+	*s = sinceFlag(unix)
+	return nil
+}
+
+// Config holds all the flags shared by every converter which embeds a Runner.
+type Config struct {
+	// BaseURL is the address the FetchSince function should download from
+	BaseURL string
+	// UserAgent is sent along with every request made by FetchSince
+	UserAgent string
+
+	// StateDir, when non-empty, enables incremental fetching: the last
+	// successful run's timestamp and per-shard digests are persisted there
+	// between runs. Only used with -d.
+	StateDir string
+	// CacheDir, when non-empty, stores the converted items of unchanged
+	// shards so they can be replayed without re-parsing. Only used with -d
+	// and -state-dir.
+	CacheDir string
+	// ForceRefresh disables the StateDir digest cache and always re-fetches
+	// every shard.
+	ForceRefresh bool
+
+	// Workers is the size of the worker pool used to run Convert() between
+	// the fetch/read channel and the encoder. 0 or 1 means no parallelism.
+	Workers int
+	// OutPath, when non-empty, is a file to write the output to instead of
+	// stdout. A ".gz" suffix gzip-compresses it.
+	OutPath string
+
+	// EnrichNVD turns on the NVDEnricher stage, filling in CVSS/CWE/references
+	// missing from vendor converters using a local mirror of the NVD feeds.
+	EnrichNVD bool
+	// NVDMirrorDir is where the NVDEnricher keeps its local mirror.
+	NVDMirrorDir string
+	// NVDBaseURL overrides where the NVD JSON 1.1 feeds are downloaded from.
+	NVDBaseURL string
+
+	// Progress selects the -progress reporting mode: "" (off), "json" or "tty".
+	Progress string
+
+	download      bool
+	convert       bool
+	downloadSince sinceFlag
+	outputFormat  string
+}
+
+// Supported values of the -output flag.
+const (
+	outputFormatNVD10  = "nvd10"
+	outputFormatCVE5   = "cve5"
+	outputFormatNDJSON = "ndjson"
+)
+
+// addFlags registers the common flags on the default flag.CommandLine
+func (c *Config) addFlags() {
+	flag.BoolVar(&c.download, "d", false, "download vulnerabilities instead of reading them from stdin/files")
+	flag.BoolVar(&c.convert, "c", false, "convert vulnerabilities to the schema selected by -output before printing them")
+	flag.Var(&c.downloadSince, "since", "download vulnerabilities modified since this RFC3339 timestamp or unix time (only used with -d)")
+	flag.StringVar(&c.BaseURL, "base_url", c.BaseURL, "base URL to download vulnerabilities from (only used with -d)")
+	flag.StringVar(&c.UserAgent, "user_agent", "nvdtools", "User-Agent header sent with every download request")
+	flag.StringVar(&c.outputFormat, "output", outputFormatNVD10, "output format: nvd10 (NVD JSON 1.0 feed), cve5 (CVE Record Format 5.x) or ndjson (one NVD CVE item per line)")
+	flag.StringVar(&c.StateDir, "state-dir", "", "directory to persist incremental fetch state (last run timestamp, shard digests); enables incremental fetching when set (only used with -d)")
+	flag.StringVar(&c.CacheDir, "cache-dir", "", "directory to cache converted items of unchanged shards; defaults to state-dir/cache when -state-dir is set")
+	flag.BoolVar(&c.ForceRefresh, "force-refresh", false, "ignore the state dir's digest cache and re-fetch every shard (only used with -d and -state-dir)")
+	flag.IntVar(&c.Workers, "workers", 1, "number of goroutines to run Convert() in parallel")
+	flag.StringVar(&c.OutPath, "out", "", "file to write output to instead of stdout; a .gz suffix gzip-compresses it")
+	flag.BoolVar(&c.EnrichNVD, "enrich-nvd", false, "fill in missing CVSS/CWE/references using a local mirror of the NVD JSON feeds")
+	flag.StringVar(&c.NVDMirrorDir, "nvd-mirror-dir", "", "directory to keep the NVD JSON feed mirror in (required with -enrich-nvd)")
+	flag.StringVar(&c.NVDBaseURL, "nvd-base-url", defaultNVDBaseURL, "base URL to download the NVD JSON 1.1 feeds from")
+	flag.StringVar(&c.Progress, "progress", "", "emit pipeline progress: \"json\" for newline-delimited JSON events on stderr, \"tty\" for an in-place human status line")
+}
+
+// validate makes sure the flag values make sense together
+func (c *Config) validate() error {
+	if c.download && flag.NArg() > 0 {
+		return fmt.Errorf("-d and file arguments are mutually exclusive")
+	}
+	switch c.outputFormat {
+	case outputFormatNVD10, outputFormatCVE5, outputFormatNDJSON:
+	default:
+		return fmt.Errorf("invalid -output %q: must be one of %q, %q, %q", c.outputFormat, outputFormatNVD10, outputFormatCVE5, outputFormatNDJSON)
+	}
+	if c.EnrichNVD && c.NVDMirrorDir == "" {
+		return fmt.Errorf("-enrich-nvd requires -nvd-mirror-dir")
+	}
+	if c.EnrichNVD && c.outputFormat == outputFormatCVE5 {
+		return fmt.Errorf("-enrich-nvd enriches NVD CVE items and has no effect on -output=%s records", outputFormatCVE5)
+	}
+	switch c.Progress {
+	case "", progressJSON, progressTTY:
+	default:
+		return fmt.Errorf("invalid -progress %q: must be one of %q, %q", c.Progress, progressJSON, progressTTY)
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	nvd "github.com/facebookincubator/nvdtools/cvefeed/jsonschema"
+)
+
+// defaultNVDBaseURL is where the official NVD JSON 1.1 feeds are published.
+const defaultNVDBaseURL = "https://nvd.nist.gov/feeds/json/cve/1.1"
+
+var cveIDPattern = regexp.MustCompile(`^CVE-\d{4}-\d+$`)
+
+// Enricher fills in metadata that vendor converters routinely omit onto an
+// already-converted NVD CVE item, without overwriting anything the converter
+// already populated.
+type Enricher interface {
+	// Enrich mutates item in place, filling in only the fields it's confident about.
+	Enrich(item *nvd.NVDCVEFeedJSON10DefCVEItem) error
+}
+
+// NVDEnricher enriches converted items with CVSSv2/CVSSv3 scores, CWEs and
+// references sourced from a local mirror of the official NVD JSON feeds.
+type NVDEnricher struct {
+	MirrorDir string
+	BaseURL   string
+
+	mu    sync.RWMutex
+	index map[string]*nvd.NVDCVEFeedJSON10DefCVEItem
+}
+
+// nvdShards are the official NVD JSON 1.1 feed files the mirror pulls in:
+// the yearly archives, plus the "modified" and "recent" deltas.
+func nvdShards() []string {
+	shards := []string{"modified", "recent"}
+	for y := 2002; y <= time.Now().Year(); y++ {
+		shards = append(shards, strconv.Itoa(y))
+	}
+	return shards
+}
+
+// NewNVDEnricher builds an NVDEnricher whose local mirror lives under
+// mirrorDir, refreshing any shard whose .meta SHA-256 sidecar has changed.
+func NewNVDEnricher(mirrorDir, baseURL string) (*NVDEnricher, error) {
+	if baseURL == "" {
+		baseURL = defaultNVDBaseURL
+	}
+	if err := os.MkdirAll(mirrorDir, 0755); err != nil {
+		return nil, fmt.Errorf("couldn't create NVD mirror dir %q: %v", mirrorDir, err)
+	}
+
+	e := &NVDEnricher{
+		MirrorDir: mirrorDir,
+		BaseURL:   baseURL,
+		index:     make(map[string]*nvd.NVDCVEFeedJSON10DefCVEItem),
+	}
+	for _, shard := range nvdShards() {
+		if err := e.refreshShard(shard); err != nil {
+			fmt.Fprintf(os.Stderr, "error while refreshing NVD mirror shard %q: %v\n", shard, err)
+		}
+	}
+	return e, nil
+}
+
+// Enrich implements Enricher.
+func (e *NVDEnricher) Enrich(item *nvd.NVDCVEFeedJSON10DefCVEItem) error {
+	if item == nil || item.CVE == nil || item.CVE.CVEDataMeta == nil {
+		return nil
+	}
+	id := item.CVE.CVEDataMeta.ID
+	if !cveIDPattern.MatchString(id) {
+		return nil
+	}
+
+	e.mu.RLock()
+	src, ok := e.index[id]
+	e.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	if item.Impact == nil {
+		item.Impact = src.Impact
+	} else if src.Impact != nil {
+		if item.Impact.BaseMetricV2 == nil {
+			item.Impact.BaseMetricV2 = src.Impact.BaseMetricV2
+		}
+		if item.Impact.BaseMetricV3 == nil {
+			item.Impact.BaseMetricV3 = src.Impact.BaseMetricV3
+		}
+	}
+	if item.CVE.Problemtype == nil {
+		item.CVE.Problemtype = src.CVE.Problemtype
+	}
+	if item.CVE.References == nil {
+		item.CVE.References = src.CVE.References
+	}
+	if item.PublishedDate == "" {
+		item.PublishedDate = src.PublishedDate
+	}
+	return nil
+}
+
+// refreshShard downloads shard's .meta sidecar, skips the shard if its
+// SHA-256 matches the digest cached from the previous run, and otherwise
+// re-downloads and re-indexes it. Either way, whatever is on disk afterwards
+// is (re-)loaded into the in-memory index.
+func (e *NVDEnricher) refreshShard(shard string) error {
+	metaURL := fmt.Sprintf("%s/nvdcve-1.1-%s.meta", e.BaseURL, shard)
+	gzURL := fmt.Sprintf("%s/nvdcve-1.1-%s.json.gz", e.BaseURL, shard)
+	gzPath := filepath.Join(e.MirrorDir, fmt.Sprintf("nvdcve-1.1-%s.json.gz", shard))
+	digestPath := gzPath + ".sha256"
+
+	remoteDigest, err := fetchMetaDigest(metaURL)
+	if err != nil {
+		return fmt.Errorf("couldn't fetch %q: %v", metaURL, err)
+	}
+
+	localDigest, _ := os.ReadFile(digestPath)
+	if string(localDigest) != remoteDigest {
+		if err := downloadFile(gzURL, gzPath); err != nil {
+			return fmt.Errorf("couldn't download %q: %v", gzURL, err)
+		}
+		if err := os.WriteFile(digestPath, []byte(remoteDigest), 0644); err != nil {
+			return fmt.Errorf("couldn't persist digest for %q: %v", shard, err)
+		}
+	}
+
+	return e.loadShard(gzPath)
+}
+
+// loadShard reads a previously downloaded shard from disk and merges its
+// items into the in-memory index.
+func (e *NVDEnricher) loadShard(gzPath string) error {
+	f, err := os.Open(gzPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	var feed nvd.NVDCVEFeedJSON10
+	if err := json.NewDecoder(gz).Decode(&feed); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, item := range feed.CVEItems {
+		if item == nil || item.CVE == nil || item.CVE.CVEDataMeta == nil {
+			continue
+		}
+		e.index[item.CVE.CVEDataMeta.ID] = item
+	}
+	return nil
+}
+
+// fetchMetaDigest downloads a .meta sidecar and returns its sha256 field,
+// e.g. from a line "sha256:1F2E3D...".
+func fetchMetaDigest(url string) (string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(body), "\n") {
+		if strings.HasPrefix(line, "sha256:") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "sha256:")), nil
+		}
+	}
+	return "", fmt.Errorf("no sha256 field in %q", url)
+}
+
+func downloadFile(url, path string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, resp.Body)
+	return err
+}
@@ -21,9 +21,12 @@ import (
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"sync"
+	"time"
 
 	nvd "github.com/facebookincubator/nvdtools/cvefeed/jsonschema"
+	"github.com/facebookincubator/nvdtools/cveschema5"
 )
 
 // Convertible is any struct which knows how to convert itself to NVD CVE Item
@@ -34,6 +37,15 @@ type Convertible interface {
 	Convert() (*nvd.NVDCVEFeedJSON10DefCVEItem, error)
 }
 
+// ConvertibleV5 is implemented by converters which can also produce a CVE
+// Record Format 5.x record. It's optional: a Convertible which doesn't
+// implement it is still emitted through the NVD JSON 1.0 path when -output=cve5
+// is requested.
+type ConvertibleV5 interface {
+	// ConvertV5 should return a new CVE Record, or an error if it's not possible
+	ConvertV5() (*cveschema5.CVERecord, error)
+}
+
 // Read should read the vulnerabilities from the given reader and push them into the channel
 // The contents of the reader should be a slice of structs which are convertibles
 // channel will be created and mustn't be closed
@@ -49,6 +61,24 @@ type Runner struct {
 	Config
 	FetchSince
 	Read
+
+	// Source names this converter for the StateStore/cache on disk, e.g. "redhat".
+	// Required for incremental fetching (Config.StateDir) to do anything.
+	Source string
+	// Shards optionally exposes shard-level fetching, enabling incremental
+	// fetching through Config.StateDir/CacheDir/ForceRefresh. Converters which
+	// don't set it always fetch the whole feed via FetchSince.
+	Shards ShardFetcher
+	// Enricher optionally post-processes every converted item before it's
+	// encoded. When nil and Config.EnrichNVD is set, Run builds an NVDEnricher
+	// from Config.NVDMirrorDir/NVDBaseURL.
+	Enricher Enricher
+
+	progress ProgressReporter
+	// commitFetch, when set by setupIncrementalFetch, persists this run as
+	// the new "last successful run". Run calls it only once the whole
+	// pipeline (fetch, convert, encode) has succeeded.
+	commitFetch func() error
 }
 
 // Run should be called in main function of the converter
@@ -56,6 +86,11 @@ type Runner struct {
 // Finally, it will output it as json to stdout
 func (r *Runner) Run() error {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		return r.Serve(os.Args[2:])
+	}
+
 	r.Config.addFlags()
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n", os.Args[0])
@@ -68,36 +103,148 @@ func (r *Runner) Run() error {
 		return fmt.Errorf("config is invalid: %v", err)
 	}
 
+	if err := r.setupIncrementalFetch(); err != nil {
+		return fmt.Errorf("couldn't set up incremental fetching: %v", err)
+	}
+	if err := r.setupEnricher(); err != nil {
+		return fmt.Errorf("couldn't set up NVD enrichment: %v", err)
+	}
+	r.progress = newProgressReporter(r.Config.Progress, os.Stderr)
+
 	vulns, err := r.getVulnerabilities()
 	if err != nil {
 		return fmt.Errorf("couldn't get vulnerabilities: %v", err)
 	}
 
+	out, closeOut, err := r.Config.openOutput()
+	if err != nil {
+		return fmt.Errorf("couldn't open output: %v", err)
+	}
+	defer closeOut()
+
 	if r.Config.convert {
-		feed := getNVDFeed(vulns)
-		if err := json.NewEncoder(os.Stdout).Encode(feed); err != nil {
-			return fmt.Errorf("couldn't write NVD feed: %v", err)
+		switch r.Config.outputFormat {
+		case outputFormatCVE5:
+			if err := encodeCVE5OrFallback(out, vulns, r.Config.Workers, r.Enricher, r.progress); err != nil {
+				return fmt.Errorf("couldn't write CVE 5.x records: %v", err)
+			}
+		case outputFormatNDJSON:
+			if err := streamNDJSON(out, vulns, r.Config.Workers, r.Enricher, r.progress); err != nil {
+				return fmt.Errorf("couldn't write ndjson: %v", err)
+			}
+		default:
+			if err := streamNVDFeed(out, vulns, r.Config.Workers, r.Enricher, r.progress); err != nil {
+				return fmt.Errorf("couldn't write NVD feed: %v", err)
+			}
 		}
-		return nil
+		return r.commitFetchState()
 	}
 
 	m := make(map[string]Convertible)
 	for v := range vulns {
 		m[v.ID()] = v
 	}
-	if err := json.NewEncoder(os.Stdout).Encode(m); err != nil {
+	if err := json.NewEncoder(out).Encode(m); err != nil {
 		return fmt.Errorf("couldn't write vulnerabilities: %v", err)
 	}
 
+	return r.commitFetchState()
+}
+
+// commitFetchState persists this run as the new "last successful run", via
+// the commitFetch hook setupIncrementalFetch installs. It's only reached
+// once the whole pipeline has succeeded, so a failed run leaves the
+// previous LastRun (and thus the next run's default -since) untouched.
+func (r *Runner) commitFetchState() error {
+	if r.commitFetch == nil {
+		return nil
+	}
+	if err := r.commitFetch(); err != nil {
+		log.Printf("error while persisting fetch state: %v", err)
+	}
+	return nil
+}
+
+// setupIncrementalFetch replaces r.FetchSince with a CachingFetcher over
+// r.Shards when the user asked for incremental fetching (-state-dir) and the
+// converter supports shard-level fetching (r.Shards). It also defaults -since, when not given
+// explicitly, to the last successful run's timestamp minus overlapWindow.
+func (r *Runner) setupIncrementalFetch() error {
+	if !r.Config.download || r.Config.StateDir == "" || r.Shards == nil {
+		return nil
+	}
+	if r.Source == "" {
+		return fmt.Errorf("incremental fetching requires Runner.Source to be set")
+	}
+
+	store, err := NewFSStateStore(r.Config.StateDir)
+	if err != nil {
+		return err
+	}
+
+	state, err := store.Load(r.Source)
+	if err != nil {
+		return err
+	}
+
+	if !sinceWasSet() && state.LastRun > 0 {
+		r.Config.downloadSince = sinceFlag(state.LastRun - overlapWindow)
+	}
+
+	cacheDir := r.Config.CacheDir
+	if cacheDir == "" {
+		cacheDir = filepath.Join(r.Config.StateDir, "cache")
+	}
+
+	cf := &CachingFetcher{
+		Source:       r.Source,
+		Fetcher:      r.Shards,
+		Store:        store,
+		CacheDir:     cacheDir,
+		ForceRefresh: r.Config.ForceRefresh,
+	}
+	r.FetchSince = cf.FetchSince
+	runStart := time.Now().Unix()
+	r.commitFetch = func() error { return cf.Commit(runStart) }
+
 	return nil
 }
 
+// setupEnricher builds an NVDEnricher from Config.NVDMirrorDir/NVDBaseURL when
+// -enrich-nvd is set and the converter hasn't already supplied its own Enricher.
+func (r *Runner) setupEnricher() error {
+	if !r.Config.EnrichNVD || r.Enricher != nil {
+		return nil
+	}
+	enricher, err := NewNVDEnricher(r.Config.NVDMirrorDir, r.Config.NVDBaseURL)
+	if err != nil {
+		return err
+	}
+	r.Enricher = enricher
+	return nil
+}
+
+// sinceWasSet reports whether -since was explicitly passed on the command line.
+func sinceWasSet() bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "since" {
+			set = true
+		}
+	})
+	return set
+}
+
 // getVulnerabilities will either get vulnerabilities using fetcher (if download is set) or stdin/files
 func (r *Runner) getVulnerabilities() (<-chan Convertible, error) {
 
 	if r.Config.download {
 		// fetch vulnerabilites since provided timestamp
-		return r.FetchSince(r.Config.BaseURL, r.Config.UserAgent, int64(r.Config.downloadSince))
+		fetched, err := r.FetchSince(r.Config.BaseURL, r.Config.UserAgent, int64(r.Config.downloadSince))
+		if err != nil {
+			return nil, err
+		}
+		return reportProgress(fetched, "fetch", r.Config.BaseURL, r.progress), nil
 	}
 
 	if flag.NArg() == 0 {
@@ -109,7 +256,7 @@ func (r *Runner) getVulnerabilities() (<-chan Convertible, error) {
 				log.Printf("error while reading from stdin: %v", err)
 			}
 		}()
-		return vulns, nil
+		return reportProgress(vulns, "read", "stdin", r.progress), nil
 	}
 
 	// read from files in args
@@ -125,8 +272,15 @@ func (r *Runner) getVulnerabilities() (<-chan Convertible, error) {
 				return
 			}
 			defer file.Close()
-			if err := r.Read(file, vulns); err != nil {
-				log.Printf("error while reading from file %q: %v", filename, err)
+			fileVulns := make(chan Convertible)
+			go func() {
+				defer close(fileVulns)
+				if err := r.Read(file, fileVulns); err != nil {
+					log.Printf("error while reading from file %q: %v", filename, err)
+				}
+			}()
+			for v := range reportProgress(fileVulns, "read", filename, r.progress) {
+				vulns <- v
 			}
 		}(filename)
 	}
@@ -138,16 +292,62 @@ func (r *Runner) getVulnerabilities() (<-chan Convertible, error) {
 	return vulns, nil
 }
 
-// getNVDFeed will convert the vulns in channel to NVD Feed
-func getNVDFeed(vulns <-chan Convertible) *nvd.NVDCVEFeedJSON10 {
-	var feed nvd.NVDCVEFeedJSON10
+// encodeCVE5OrFallback peeks at the first vuln to decide whether the
+// converter behind vulns implements ConvertibleV5. Converters implement it
+// (or not) as a whole, so one peek is enough: if it does, vulns are encoded
+// as CVE Record Format 5.x records (with "write" stage progress, same as the
+// other output paths); if it doesn't, -output=cve5 falls back to the NVD
+// JSON 1.0 path in full so the vulnerability payload (affected products,
+// metrics, references, ...) isn't lost. enricher only applies on that
+// fallback path: it enriches *nvd.NVDCVEFeedJSON10DefCVEItem, which a CVE
+// Record Format 5.x record isn't, so Config.validate rejects -enrich-nvd
+// together with -output=cve5 rather than silently ignoring it here.
+func encodeCVE5OrFallback(out io.Writer, vulns <-chan Convertible, workers int, enricher Enricher, reporter ProgressReporter) error {
+	first, ok := <-vulns
+	if !ok {
+		return json.NewEncoder(out).Encode([]*cveschema5.CVERecord{})
+	}
+
+	if _, supportsV5 := first.(ConvertibleV5); !supportsV5 {
+		return streamNVDFeed(out, rejoin(first, vulns), workers, enricher, reporter)
+	}
+
+	records := getCVE5Records(reportProgress(rejoin(first, vulns), "write", "", reporter))
+	return json.NewEncoder(out).Encode(records)
+}
+
+// rejoin puts first back at the head of a channel of the remaining vulns,
+// so a value consumed to make a type-assertion decision isn't dropped.
+func rejoin(first Convertible, rest <-chan Convertible) <-chan Convertible {
+	out := make(chan Convertible)
+	go func() {
+		defer close(out)
+		out <- first
+		for v := range rest {
+			out <- v
+		}
+	}()
+	return out
+}
+
+// getCVE5Records converts the vulns in channel to CVE Record Format 5.x
+// records via ConvertibleV5. Callers should only reach this once they've
+// established (see encodeCVE5OrFallback) that the converter implements it;
+// a vuln that doesn't is logged and skipped rather than emitted incomplete.
+func getCVE5Records(vulns <-chan Convertible) []*cveschema5.CVERecord {
+	var records []*cveschema5.CVERecord
 	for vuln := range vulns {
-		converted, err := vuln.Convert()
+		v5, ok := vuln.(ConvertibleV5)
+		if !ok {
+			log.Printf("vuln %q doesn't implement ConvertibleV5, skipping", vuln.ID())
+			continue
+		}
+		record, err := v5.ConvertV5()
 		if err != nil {
-			log.Printf("error while converting vuln: %v", err)
+			log.Printf("error while converting vuln to CVE 5.x record: %v", err)
 			continue
 		}
-		feed.CVEItems = append(feed.CVEItems, converted)
+		records = append(records, record)
 	}
-	return &feed
+	return records
 }
\ No newline at end of file
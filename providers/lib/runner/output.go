@@ -0,0 +1,184 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	nvd "github.com/facebookincubator/nvdtools/cvefeed/jsonschema"
+)
+
+// nvdDataType/nvdDataFormat/nvdDataVersion are the fixed NVDCVEFeedJSON10
+// envelope values the official NVD feeds publish; nvdtools converters have
+// always reused them rather than minting their own.
+const (
+	nvdDataType    = "CVE"
+	nvdDataFormat  = "MITRE"
+	nvdDataVersion = "4.0"
+)
+
+// openOutput returns the writer Run() should encode its output to: stdout by
+// default, or the file named by -out, gzip-compressed if it ends in ".gz".
+// The returned close func must always be called, even when out is stdout.
+func (c *Config) openOutput() (out io.Writer, close func(), err error) {
+	if c.OutPath == "" {
+		return os.Stdout, func() {}, nil
+	}
+
+	f, err := os.Create(c.OutPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't create %q: %v", c.OutPath, err)
+	}
+
+	if !strings.HasSuffix(c.OutPath, ".gz") {
+		return f, func() { f.Close() }, nil
+	}
+
+	gw := gzip.NewWriter(f)
+	return gw, func() { gw.Close(); f.Close() }, nil
+}
+
+// convertPool runs Convert() on vulns through a pool of workers workers wide,
+// bounding how many conversions happen concurrently rather than draining the
+// whole channel into memory first. workers < 1 behaves like workers == 1.
+// If reporter is non-nil, it's sent "convert" stage progress.
+func convertPool(vulns <-chan Convertible, workers int, reporter ProgressReporter) <-chan *nvd.NVDCVEFeedJSON10DefCVEItem {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var converted int64
+	out := make(chan *nvd.NVDCVEFeedJSON10DefCVEItem)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for v := range vulns {
+				item, err := v.Convert()
+				if err != nil {
+					log.Printf("error while converting vuln: %v", err)
+					continue
+				}
+				out <- item
+				if reporter != nil {
+					if n := atomic.AddInt64(&converted, 1); n%progressBatchSize == 0 {
+						reporter.Report("convert", "", int(n), 0, nil)
+					}
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		if reporter != nil {
+			reporter.Report("convert", "", int(atomic.LoadInt64(&converted)), 0, nil)
+		}
+		close(out)
+	}()
+	return out
+}
+
+// streamNVDFeed converts vulns through a convertPool and writes them as an
+// NVDCVEFeedJSON10 one item at a time, so at most `workers` converted items
+// are ever held in memory rather than the whole feed. If enricher is non-nil,
+// it's run on every item before it's encoded; if reporter is non-nil, it's
+// sent "write" stage progress. The envelope fields that encoding a whole
+// NVDCVEFeedJSON10 struct would produce (CVE_data_type/_format/_version,
+// _timestamp, _numberOfCVEs) are written by hand around the streamed
+// CVE_Items array; _numberOfCVEs trails the array since it isn't known until
+// every item has been streamed.
+func streamNVDFeed(w io.Writer, vulns <-chan Convertible, workers int, enricher Enricher, reporter ProgressReporter) error {
+	converted := convertPool(vulns, workers, reporter)
+	cw := &countingWriter{w: w}
+	enc := json.NewEncoder(cw)
+
+	header := fmt.Sprintf(`{"CVE_data_type":%q,"CVE_data_format":%q,"CVE_data_version":%q,"CVE_data_timestamp":%q,"CVE_Items":[`,
+		nvdDataType, nvdDataFormat, nvdDataVersion, time.Now().UTC().Format(time.RFC3339))
+	if _, err := io.WriteString(cw, header); err != nil {
+		return err
+	}
+	first := true
+	count := 0
+	for item := range converted {
+		enrich(item, enricher)
+		if !first {
+			if _, err := io.WriteString(cw, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+		count++
+		if reporter != nil && count%progressBatchSize == 0 {
+			reporter.Report("write", "", count, cw.count, nil)
+		}
+	}
+	footer := fmt.Sprintf(`],"CVE_data_numberOfCVEs":%q}`+"\n", strconv.Itoa(count))
+	if _, err := io.WriteString(cw, footer); err != nil {
+		return err
+	}
+	if reporter != nil {
+		reporter.Report("write", "", count, cw.count, nil)
+	}
+	return nil
+}
+
+// streamNDJSON converts vulns through a convertPool and writes one converted
+// item per line as it's produced. If enricher is non-nil, it's run on every
+// item before it's encoded; if reporter is non-nil, it's sent "write" stage progress.
+func streamNDJSON(w io.Writer, vulns <-chan Convertible, workers int, enricher Enricher, reporter ProgressReporter) error {
+	converted := convertPool(vulns, workers, reporter)
+	cw := &countingWriter{w: w}
+	enc := json.NewEncoder(cw)
+	count := 0
+	for item := range converted {
+		enrich(item, enricher)
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+		count++
+		if reporter != nil && count%progressBatchSize == 0 {
+			reporter.Report("write", "", count, cw.count, nil)
+		}
+	}
+	if reporter != nil {
+		reporter.Report("write", "", count, cw.count, nil)
+	}
+	return nil
+}
+
+// enrich runs enricher on item, logging (rather than failing the whole run)
+// if it errors.
+func enrich(item *nvd.NVDCVEFeedJSON10DefCVEItem, enricher Enricher) {
+	if enricher == nil {
+		return
+	}
+	if err := enricher.Enrich(item); err != nil {
+		log.Printf("error while enriching vuln: %v", err)
+	}
+}
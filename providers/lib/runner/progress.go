@@ -0,0 +1,157 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// progressBatchSize is how many items pass through a stage between progress
+// reports, so operators get real-time visibility without a report per item.
+const progressBatchSize = 500
+
+// Supported values of the -progress flag.
+const (
+	progressJSON = "json"
+	progressTTY  = "tty"
+)
+
+// ProgressEvent is one newline-delimited JSON event emitted by a
+// jsonProgressReporter, describing how far a pipeline stage has gotten for a
+// given source: the base URL for "fetch" (the whole download, not per shard),
+// an input file or "stdin" for "read", and none for "convert" and "write".
+type ProgressEvent struct {
+	TS     int64  `json:"ts"`
+	Stage  string `json:"stage"`
+	Source string `json:"source,omitempty"`
+	Count  int    `json:"count"`
+	Bytes  int64  `json:"bytes,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ProgressReporter is notified as Runner's fetch/read/convert/write stages
+// make progress, so a caller piping this runner into a job scheduler gets
+// real-time visibility instead of only a final log line.
+type ProgressReporter interface {
+	// Report records that, as of now, count items (and optionally bytes)
+	// have gone through stage for source. err is the latest error encountered,
+	// if any; it does not imply the stage is done.
+	Report(stage, source string, count int, bytes int64, err error)
+}
+
+// newProgressReporter builds the ProgressReporter selected by -progress.
+func newProgressReporter(mode string, w io.Writer) ProgressReporter {
+	switch mode {
+	case progressJSON:
+		return &jsonProgressReporter{w: w}
+	case progressTTY:
+		return &ttyProgressReporter{w: w}
+	default:
+		return noopProgressReporter{}
+	}
+}
+
+// noopProgressReporter is used when -progress isn't set.
+type noopProgressReporter struct{}
+
+func (noopProgressReporter) Report(stage, source string, count int, bytes int64, err error) {}
+
+// jsonProgressReporter writes one ProgressEvent per line to w.
+type jsonProgressReporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (r *jsonProgressReporter) Report(stage, source string, count int, bytes int64, err error) {
+	ev := ProgressEvent{TS: time.Now().Unix(), Stage: stage, Source: source, Count: count, Bytes: bytes}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	json.NewEncoder(r.w).Encode(ev)
+}
+
+// reportProgress passes Convertible items through untouched while reporting
+// stage/source progress to reporter every progressBatchSize items, plus a
+// final report once in is drained. A nil reporter is a cheap passthrough.
+func reportProgress(in <-chan Convertible, stage, source string, reporter ProgressReporter) <-chan Convertible {
+	if reporter == nil {
+		return in
+	}
+	out := make(chan Convertible)
+	go func() {
+		defer close(out)
+		count := 0
+		for v := range in {
+			count++
+			out <- v
+			if count%progressBatchSize == 0 {
+				reporter.Report(stage, source, count, 0, nil)
+			}
+		}
+		reporter.Report(stage, source, count, 0, nil)
+	}()
+	return out
+}
+
+// countingWriter wraps an io.Writer, tracking how many bytes have gone through it.
+type countingWriter struct {
+	w     io.Writer
+	count int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// ttyProgressReporter keeps a running per-(stage,source) counter and repaints
+// a single in-place status line, for interactive use when stderr is a TTY.
+type ttyProgressReporter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	counts map[string]int
+}
+
+func (r *ttyProgressReporter) Report(stage, source string, count int, bytes int64, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.counts == nil {
+		r.counts = make(map[string]int)
+	}
+	r.counts[stage+" "+source] = count
+	if err != nil {
+		fmt.Fprintf(r.w, "\n%s %s: error: %v\n", stage, source, err)
+	}
+
+	keys := make([]string, 0, len(r.counts))
+	for k := range r.counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	line := ""
+	for _, k := range keys {
+		line += fmt.Sprintf("%s=%d  ", k, r.counts[k])
+	}
+	fmt.Fprintf(r.w, "\r%s", line)
+}
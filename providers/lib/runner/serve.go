@@ -0,0 +1,291 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	nvd "github.com/facebookincubator/nvdtools/cvefeed/jsonschema"
+)
+
+// serveConfig holds the flags specific to `runner serve`.
+type serveConfig struct {
+	addr     string
+	boltPath string
+}
+
+func (c *serveConfig) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.addr, "addr", ":8080", "address to listen on")
+	fs.StringVar(&c.boltPath, "bolt", "", "path to a BoltDB file to persist tasks/items in; defaults to an in-memory store")
+}
+
+// Serve runs r as a long-running HTTP service exposing the ingest API
+// described by Run's "serve" subcommand, until the process is killed.
+func (r *Runner) Serve(args []string) error {
+	var sc serveConfig
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	sc.addFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := sc.store()
+	if err != nil {
+		return fmt.Errorf("couldn't open store: %v", err)
+	}
+
+	srv := &server{runner: r, store: store}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vulnerabilities/ingests", srv.handleIngests)
+	mux.HandleFunc("/vulnerabilities/ingests/", srv.handleIngest)
+	mux.HandleFunc("/vulnerabilities", srv.handleVulnerabilities)
+
+	log.Printf("listening on %s", sc.addr)
+	return http.ListenAndServe(sc.addr, mux)
+}
+
+func (c *serveConfig) store() (Store, error) {
+	if c.boltPath == "" {
+		return NewMemStore(), nil
+	}
+	return NewBoltStore(c.boltPath)
+}
+
+// server holds the dependencies of the HTTP handlers.
+type server struct {
+	runner *Runner
+	store  Store
+}
+
+// handleIngests serves POST /vulnerabilities/ingests and GET /vulnerabilities/ingests.
+func (s *server) handleIngests(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		s.createIngest(w, req)
+	case http.MethodGet:
+		s.listIngests(w, req)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// createIngest accepts a raw vendor feed body, runs Read+Convert on it in the
+// background and immediately returns the Task tracking that work.
+func (s *server) createIngest(w http.ResponseWriter, req *http.Request) {
+	id, err := newTaskID()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	task := &Task{ID: id, Source: s.runner.Source, Status: TaskPending, SubmittedAt: time.Now()}
+	if err := s.store.SaveTask(task); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Encode the response before handing task off to runIngest: runIngest
+	// mutates it concurrently (Status, Errors, ...), so the response must be
+	// written from the snapshot above, not read back after the goroutine starts.
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(task)
+
+	go s.runIngest(task, body)
+}
+
+// runIngest runs in the background for one ingest task.
+func (s *server) runIngest(task *Task, body []byte) {
+	task.Status = TaskRunning
+	s.store.SaveTask(task)
+
+	vulns := make(chan Convertible)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(vulns)
+		readErr <- s.runner.Read(bytes.NewReader(body), vulns)
+	}()
+
+	var items []*Item
+	for v := range vulns {
+		converted, err := v.Convert()
+		if err != nil {
+			task.Errors = append(task.Errors, err.Error())
+			continue
+		}
+		items = append(items, &Item{
+			CVEItem:       converted,
+			ID:            v.ID(),
+			Severity:      severityOf(converted),
+			PublishedDate: publishedDateOf(converted),
+			TaskID:        task.ID,
+		})
+	}
+
+	if err := <-readErr; err != nil {
+		task.Errors = append(task.Errors, err.Error())
+	}
+
+	if err := s.store.SaveItems(items); err != nil {
+		task.Errors = append(task.Errors, err.Error())
+		// Nothing was persisted, so don't count or report these items as saved.
+		items = nil
+	}
+
+	now := time.Now()
+	task.FinishedAt = &now
+	task.ItemCount = len(items)
+	switch {
+	case len(task.Errors) == 0:
+		task.Status = TaskSucceeded
+	case len(items) > 0:
+		// Some vulns converted fine; don't report the whole ingest as failed.
+		task.Status = TaskPartial
+	default:
+		task.Status = TaskFailed
+	}
+	s.store.SaveTask(task)
+}
+
+// listIngests serves GET /vulnerabilities/ingests.
+func (s *server) listIngests(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	f := TaskFilter{
+		Status: TaskStatus(q.Get("status")),
+		Offset: atoiOr(q.Get("offset"), 0),
+		Limit:  atoiOr(q.Get("limit"), 100),
+	}
+	if v := q.Get("startDate"); v != "" {
+		f.StartDate, _ = time.Parse(time.RFC3339, v)
+	}
+	if v := q.Get("endDate"); v != "" {
+		f.EndDate, _ = time.Parse(time.RFC3339, v)
+	}
+
+	tasks, total, err := s.store.ListTasks(f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"items": tasks, "total": total})
+}
+
+// handleIngest serves GET /vulnerabilities/ingests/{id}.
+func (s *server) handleIngest(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(req.URL.Path, "/vulnerabilities/ingests/")
+	if id == "" {
+		http.Error(w, "missing task id", http.StatusBadRequest)
+		return
+	}
+	task, err := s.store.GetTask(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, task)
+}
+
+// handleVulnerabilities serves GET /vulnerabilities.
+func (s *server) handleVulnerabilities(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := req.URL.Query()
+	f := ItemFilter{
+		ID:            q.Get("id"),
+		Severity:      q.Get("severity"),
+		PublishedFrom: q.Get("publishedFrom"),
+		PublishedTo:   q.Get("publishedTo"),
+		Offset:        atoiOr(q.Get("offset"), 0),
+		Limit:         atoiOr(q.Get("limit"), 100),
+	}
+
+	items, total, err := s.store.ListItems(f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"items": items, "total": total})
+}
+
+func severityOf(item *nvd.NVDCVEFeedJSON10DefCVEItem) string {
+	if item == nil || item.Impact == nil {
+		return ""
+	}
+	if item.Impact.BaseMetricV3 != nil && item.Impact.BaseMetricV3.CVSSV3 != nil {
+		return item.Impact.BaseMetricV3.CVSSV3.BaseSeverity
+	}
+	if item.Impact.BaseMetricV2 != nil {
+		return item.Impact.BaseMetricV2.Severity
+	}
+	return ""
+}
+
+func publishedDateOf(item *nvd.NVDCVEFeedJSON10DefCVEItem) string {
+	if item == nil {
+		return ""
+	}
+	return item.PublishedDate
+}
+
+func newTaskID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("couldn't generate task id: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// atoiOr parses s as a non-negative int, or returns def if s is empty,
+// unparseable, or negative.
+func atoiOr(s string, def int) int {
+	if s == "" {
+		return def
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return def
+	}
+	return n
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
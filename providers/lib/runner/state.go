@@ -0,0 +1,291 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	nvd "github.com/facebookincubator/nvdtools/cvefeed/jsonschema"
+)
+
+// overlapWindow is subtracted from the last successful run's timestamp when
+// deriving the next run's downloadSince, so that items modified right at the
+// edge of a run aren't missed because of clock skew or publish delays.
+const overlapWindow = 3600 // 1 hour, in seconds
+
+// State is the persisted fetch state for a single source (converter).
+type State struct {
+	// LastRun is the unix timestamp of the last successful run.
+	LastRun int64 `json:"last_run"`
+	// Digests maps a shard URL to the hex SHA-256 of its last fetched payload.
+	Digests map[string]string `json:"digests"`
+}
+
+// StateStore persists per-source State across runs, so that a Runner can
+// resume incrementally instead of always fetching the whole feed.
+type StateStore interface {
+	// Load returns the stored state for source, or a zero State if there's none yet.
+	Load(source string) (*State, error)
+	// Save persists the state for source.
+	Save(source string, s *State) error
+}
+
+// FSStateStore is a StateStore backed by one JSON file per source in Dir.
+type FSStateStore struct {
+	Dir string
+}
+
+// NewFSStateStore returns a StateStore rooted at dir, creating it if necessary.
+func NewFSStateStore(dir string) (*FSStateStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("couldn't create state dir %q: %v", dir, err)
+	}
+	return &FSStateStore{Dir: dir}, nil
+}
+
+func (s *FSStateStore) path(source string) string {
+	return filepath.Join(s.Dir, source+".json")
+}
+
+// Load implements StateStore.
+func (s *FSStateStore) Load(source string) (*State, error) {
+	data, err := os.ReadFile(s.path(source))
+	if os.IsNotExist(err) {
+		return &State{Digests: make(map[string]string)}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read state for %q: %v", source, err)
+	}
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("couldn't parse state for %q: %v", source, err)
+	}
+	if st.Digests == nil {
+		st.Digests = make(map[string]string)
+	}
+	return &st, nil
+}
+
+// Save implements StateStore.
+func (s *FSStateStore) Save(source string, st *State) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("couldn't marshal state for %q: %v", source, err)
+	}
+	return os.WriteFile(s.path(source), data, 0644)
+}
+
+// ShardFetcher is implemented by converters which can fetch and parse one
+// feed shard (e.g. one yearly file) at a time. CachingFetcher uses it to
+// skip shards whose content hasn't changed since the last run.
+type ShardFetcher interface {
+	// Shards returns the list of shard URLs to fetch for the given baseURL.
+	Shards(baseURL string) ([]string, error)
+	// FetchShard downloads and parses a single shard, also returning the raw
+	// payload so CachingFetcher can hash and cache it.
+	FetchShard(url, userAgent string) ([]Convertible, []byte, error)
+}
+
+// DigestFetcher is implemented by ShardFetchers which can report a shard's
+// SHA-256 (e.g. from a .meta sidecar) without downloading the full shard.
+// It's optional: a ShardFetcher which doesn't implement it still
+// works, but CachingFetcher must fall back to a full FetchShard to compute
+// the digest, which costs the bandwidth this interface exists to avoid.
+type DigestFetcher interface {
+	// FetchDigest returns the hex SHA-256 of the raw payload FetchShard would
+	// return for url. CachingFetcher compares it against the SHA-256 of the
+	// payload it last downloaded, so any other kind of digest (such as an
+	// HTTP ETag) never matches and the shard is always re-fetched.
+	FetchDigest(url, userAgent string) (string, error)
+}
+
+// CachingFetcher wraps a ShardFetcher with a StateStore-backed digest cache:
+// a shard whose SHA-256 matches the digest from the previous run is skipped,
+// and its previously-converted items are replayed from an on-disk cache
+// instead of being re-parsed. This mirrors the way NVD's own .meta sidecars
+// let consumers skip unchanged yearly feeds.
+type CachingFetcher struct {
+	Source       string
+	Fetcher      ShardFetcher
+	Store        StateStore
+	CacheDir     string
+	ForceRefresh bool
+}
+
+// FetchSince implements the FetchSince function type and can be assigned directly to Runner.FetchSince.
+// It only updates the on-disk shard digests as shards are fetched; State.LastRun
+// (the "last successful run" timestamp setupIncrementalFetch derives -since
+// from) is left untouched until the caller confirms the whole run succeeded
+// by calling Commit.
+func (c *CachingFetcher) FetchSince(baseURL, userAgent string, since int64) (<-chan Convertible, error) {
+	shards, err := c.Fetcher.Shards(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't list shards: %v", err)
+	}
+
+	state, err := c.Store.Load(c.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	vulns := make(chan Convertible)
+	go func() {
+		defer close(vulns)
+		for _, url := range shards {
+			items, err := c.fetchShard(url, userAgent, state)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error while fetching shard %q: %v\n", url, err)
+				continue
+			}
+			for _, item := range items {
+				vulns <- item
+			}
+		}
+	}()
+	return vulns, nil
+}
+
+// Commit records now as the run's LastRun, marking it successful so the next
+// run's default -since is derived from it. Callers must only call Commit
+// once everything downstream of FetchSince (conversion, encoding) has
+// succeeded; a failed run should leave LastRun untouched.
+func (c *CachingFetcher) Commit(now int64) error {
+	state, err := c.Store.Load(c.Source)
+	if err != nil {
+		return err
+	}
+	state.LastRun = now
+	return c.Store.Save(c.Source, state)
+}
+
+// fetchShard downloads url unless its digest is unchanged and ForceRefresh is
+// false, in which case it replays the cached items instead. When it downloads,
+// the new digest is persisted immediately so it survives even if a later shard
+// or downstream stage fails.
+func (c *CachingFetcher) fetchShard(url, userAgent string, state *State) ([]Convertible, error) {
+	cachePath := filepath.Join(c.CacheDir, shardCacheName(url))
+
+	if !c.ForceRefresh {
+		if cached, ok, err := c.loadCache(cachePath); err == nil && ok {
+			digest, err := c.peekDigest(url, userAgent)
+			if err == nil && digest == state.Digests[url] {
+				return cached, nil
+			}
+		}
+	}
+
+	items, raw, err := c.Fetcher.FetchShard(url, userAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	state.Digests[url] = sha256Hex(raw)
+	if err := c.Store.Save(c.Source, state); err != nil {
+		fmt.Fprintf(os.Stderr, "error while saving digest for %q: %v\n", url, err)
+	}
+	if err := c.saveCache(cachePath, items); err != nil {
+		fmt.Fprintf(os.Stderr, "error while caching shard %q: %v\n", url, err)
+	}
+	return items, nil
+}
+
+// peekDigest returns url's digest without downloading its full payload, by
+// way of the DigestFetcher extension interface. Fetchers which don't
+// implement it fall back to a full FetchShard, which costs the bandwidth
+// this method otherwise exists to avoid.
+func (c *CachingFetcher) peekDigest(url, userAgent string) (string, error) {
+	if df, ok := c.Fetcher.(DigestFetcher); ok {
+		return df.FetchDigest(url, userAgent)
+	}
+	_, raw, err := c.Fetcher.FetchShard(url, userAgent)
+	if err != nil {
+		return "", err
+	}
+	return sha256Hex(raw), nil
+}
+
+func (c *CachingFetcher) loadCache(path string) ([]Convertible, bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	var cached []*nvd.NVDCVEFeedJSON10DefCVEItem
+	if err := json.NewDecoder(f).Decode(&cached); err != nil {
+		return nil, false, err
+	}
+	items := make([]Convertible, len(cached))
+	for i, item := range cached {
+		items[i] = &cachedConvertible{item: item}
+	}
+	return items, true, nil
+}
+
+func (c *CachingFetcher) saveCache(path string, items []Convertible) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	converted := make([]*nvd.NVDCVEFeedJSON10DefCVEItem, 0, len(items))
+	for _, item := range items {
+		cv, err := item.Convert()
+		if err != nil {
+			continue
+		}
+		converted = append(converted, cv)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(converted)
+}
+
+// cachedConvertible replays a previously-converted NVD CVE item as a Convertible.
+type cachedConvertible struct {
+	item *nvd.NVDCVEFeedJSON10DefCVEItem
+}
+
+// ID implements Convertible.
+func (c *cachedConvertible) ID() string {
+	if c.item == nil || c.item.CVE == nil || c.item.CVE.CVEDataMeta == nil {
+		return ""
+	}
+	return c.item.CVE.CVEDataMeta.ID
+}
+
+// Convert implements Convertible.
+func (c *cachedConvertible) Convert() (*nvd.NVDCVEFeedJSON10DefCVEItem, error) {
+	return c.item, nil
+}
+
+func shardCacheName(url string) string {
+	return sha256Hex([]byte(url)) + ".json"
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,235 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	nvd "github.com/facebookincubator/nvdtools/cvefeed/jsonschema"
+)
+
+// TaskStatus is the lifecycle state of an ingest Task.
+type TaskStatus string
+
+// Valid values of TaskStatus.
+const (
+	TaskPending   TaskStatus = "pending"
+	TaskRunning   TaskStatus = "running"
+	TaskSucceeded TaskStatus = "succeeded"
+	// TaskPartial means some vulns converted and were saved but others hit a
+	// Read/Convert error; ItemCount and len(Errors) say how many of each.
+	TaskPartial TaskStatus = "partial"
+	TaskFailed  TaskStatus = "failed"
+)
+
+// Task tracks one POST /vulnerabilities/ingests request from submission to completion.
+type Task struct {
+	ID          string     `json:"id"`
+	Source      string     `json:"source"`
+	Status      TaskStatus `json:"status"`
+	SubmittedAt time.Time  `json:"submittedAt"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+	ItemCount   int        `json:"itemCount"`
+	Errors      []string   `json:"errors,omitempty"`
+}
+
+// TaskFilter narrows down ListTasks.
+type TaskFilter struct {
+	StartDate time.Time
+	EndDate   time.Time
+	Status    TaskStatus
+	Offset    int
+	Limit     int
+}
+
+// Item is a converted CVE, stored alongside the fields GET /vulnerabilities filters on.
+type Item struct {
+	CVEItem       *nvd.NVDCVEFeedJSON10DefCVEItem `json:"cveItem"`
+	ID            string                           `json:"id"`
+	Severity      string                           `json:"severity"`
+	PublishedDate string                           `json:"publishedDate"`
+	TaskID        string                           `json:"taskId"`
+}
+
+// itemKey returns the key Item is stored under: TaskID+ID rather than bare
+// ID, so that two ingests of the same CVE (or two advisories mapping to it)
+// don't overwrite each other's item. ID itself stays the CVE id, since
+// that's what ItemFilter.ID and the JSON response match/expose.
+func itemKey(it *Item) string {
+	return it.TaskID + "/" + it.ID
+}
+
+// ItemFilter narrows down ListItems.
+type ItemFilter struct {
+	ID            string
+	Severity      string
+	PublishedFrom string
+	PublishedTo   string
+	Offset        int
+	Limit         int
+}
+
+// Store persists ingest tasks and the items they produced, for `runner serve` mode.
+type Store interface {
+	SaveTask(t *Task) error
+	GetTask(id string) (*Task, error)
+	ListTasks(f TaskFilter) ([]*Task, int, error)
+
+	SaveItems(items []*Item) error
+	ListItems(f ItemFilter) ([]*Item, int, error)
+}
+
+// MemStore is an in-memory Store, useful for development and tests.
+type MemStore struct {
+	mu    sync.RWMutex
+	tasks map[string]*Task
+	items map[string]*Item
+}
+
+// NewMemStore returns an empty, ready to use MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{
+		tasks: make(map[string]*Task),
+		items: make(map[string]*Item),
+	}
+}
+
+// SaveTask implements Store.
+func (s *MemStore) SaveTask(t *Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp := *t
+	s.tasks[t.ID] = &cp
+	return nil
+}
+
+// GetTask implements Store.
+func (s *MemStore) GetTask(id string) (*Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tasks[id]
+	if !ok {
+		return nil, fmt.Errorf("no task with id %q", id)
+	}
+	cp := *t
+	return &cp, nil
+}
+
+// ListTasks implements Store.
+func (s *MemStore) ListTasks(f TaskFilter) ([]*Task, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matched []*Task
+	for _, t := range s.tasks {
+		if !taskMatches(t, f) {
+			continue
+		}
+		cp := *t
+		matched = append(matched, &cp)
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].SubmittedAt.Before(matched[j].SubmittedAt) })
+
+	return paginateTasks(matched, f.Offset, f.Limit), len(matched), nil
+}
+
+// SaveItems implements Store.
+func (s *MemStore) SaveItems(items []*Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, it := range items {
+		cp := *it
+		s.items[itemKey(it)] = &cp
+	}
+	return nil
+}
+
+// ListItems implements Store.
+func (s *MemStore) ListItems(f ItemFilter) ([]*Item, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matched []*Item
+	for _, it := range s.items {
+		if !itemMatches(it, f) {
+			continue
+		}
+		cp := *it
+		matched = append(matched, &cp)
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].ID < matched[j].ID })
+
+	return paginateItems(matched, f.Offset, f.Limit), len(matched), nil
+}
+
+func taskMatches(t *Task, f TaskFilter) bool {
+	if f.Status != "" && t.Status != f.Status {
+		return false
+	}
+	if !f.StartDate.IsZero() && t.SubmittedAt.Before(f.StartDate) {
+		return false
+	}
+	if !f.EndDate.IsZero() && t.SubmittedAt.After(f.EndDate) {
+		return false
+	}
+	return true
+}
+
+func itemMatches(it *Item, f ItemFilter) bool {
+	if f.ID != "" && it.ID != f.ID {
+		return false
+	}
+	if f.Severity != "" && it.Severity != f.Severity {
+		return false
+	}
+	if f.PublishedFrom != "" && it.PublishedDate < f.PublishedFrom {
+		return false
+	}
+	if f.PublishedTo != "" && it.PublishedDate > f.PublishedTo {
+		return false
+	}
+	return true
+}
+
+func paginateTasks(all []*Task, offset, limit int) []*Task {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(all) {
+		return nil
+	}
+	all = all[offset:]
+	if limit > 0 && limit < len(all) {
+		all = all[:limit]
+	}
+	return all
+}
+
+func paginateItems(all []*Item, offset, limit int) []*Item {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(all) {
+		return nil
+	}
+	all = all[offset:]
+	if limit > 0 && limit < len(all) {
+		all = all[:limit]
+	}
+	return all
+}
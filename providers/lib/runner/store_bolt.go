@@ -0,0 +1,148 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	tasksBucket = []byte("tasks")
+	itemsBucket = []byte("items")
+)
+
+// BoltStore is a Store backed by a single BoltDB file, for deployments that
+// need the ingest API to survive a restart without standing up a database.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens (creating if necessary) a BoltStore at path.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open bolt db %q: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(tasksBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(itemsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("couldn't initialize bolt db %q: %v", path, err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Close releases the underlying BoltDB file.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// SaveTask implements Store.
+func (s *BoltStore) SaveTask(t *Task) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(tasksBucket).Put([]byte(t.ID), data)
+	})
+}
+
+// GetTask implements Store.
+func (s *BoltStore) GetTask(id string) (*Task, error) {
+	var task Task
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(tasksBucket).Get([]byte(id))
+		if data == nil {
+			return fmt.Errorf("no task with id %q", id)
+		}
+		return json.Unmarshal(data, &task)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// ListTasks implements Store.
+func (s *BoltStore) ListTasks(f TaskFilter) ([]*Task, int, error) {
+	var matched []*Task
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tasksBucket).ForEach(func(_, data []byte) error {
+			var t Task
+			if err := json.Unmarshal(data, &t); err != nil {
+				return err
+			}
+			if taskMatches(&t, f) {
+				matched = append(matched, &t)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].SubmittedAt.Before(matched[j].SubmittedAt) })
+	return paginateTasks(matched, f.Offset, f.Limit), len(matched), nil
+}
+
+// SaveItems implements Store.
+func (s *BoltStore) SaveItems(items []*Item) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(itemsBucket)
+		for _, it := range items {
+			data, err := json.Marshal(it)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(itemKey(it)), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListItems implements Store.
+func (s *BoltStore) ListItems(f ItemFilter) ([]*Item, int, error) {
+	var matched []*Item
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(itemsBucket).ForEach(func(_, data []byte) error {
+			var it Item
+			if err := json.Unmarshal(data, &it); err != nil {
+				return err
+			}
+			if itemMatches(&it, f) {
+				matched = append(matched, &it)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].ID < matched[j].ID })
+	return paginateItems(matched, f.Offset, f.Limit), len(matched), nil
+}